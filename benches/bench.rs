@@ -1,10 +1,15 @@
-use self::common::{bench_compute_hash, bench_get, bench_insert};
-use common::{bench_compute_hash_inserts, bench_compute_hash_sorted};
+use self::common::{bench_compute_hash, bench_get, bench_insert, bench_remove};
+use common::{
+    bench_compute_hash_inserts, bench_compute_hash_sorted, bench_mainnet_get, bench_mainnet_hash,
+    bench_mainnet_insert, mainnet_accounts, mainnet_storage,
+};
 use criterion::{criterion_group, criterion_main, Criterion};
+use replay::bench_replay;
 use sha3::Keccak256;
-use std::time::Duration;
+use std::{env, time::Duration};
 
 mod common;
+mod replay;
 
 fn criterion_benchmark(c: &mut Criterion) {
     c.benchmark_group("calculate root keccak256 hash with random items")
@@ -51,6 +56,50 @@ fn criterion_benchmark(c: &mut Criterion) {
         .sample_size(10)
         .bench_function("10M", bench_insert::<10_000_000>())
         .bench_function("100M", bench_insert::<100_000_000>());
+
+    c.benchmark_group("remove() from a tree made with random values")
+        .bench_function("1k", bench_remove::<1_000>())
+        .bench_function("10k", bench_remove::<10_000>())
+        .bench_function("100k", bench_remove::<100_000>())
+        .bench_function("1M", bench_remove::<1_000_000>());
+
+    c.benchmark_group("get() from a mainnet-like account tree")
+        .bench_function("1k", bench_mainnet_get::<1_000>(mainnet_accounts))
+        .bench_function("10k", bench_mainnet_get::<10_000>(mainnet_accounts))
+        .bench_function("100k", bench_mainnet_get::<100_000>(mainnet_accounts))
+        .bench_function("1M", bench_mainnet_get::<1_000_000>(mainnet_accounts));
+
+    c.benchmark_group("insert() into a mainnet-like account tree")
+        .bench_function("1k", bench_mainnet_insert::<1_000>(mainnet_accounts))
+        .bench_function("10k", bench_mainnet_insert::<10_000>(mainnet_accounts))
+        .bench_function("100k", bench_mainnet_insert::<100_000>(mainnet_accounts))
+        .bench_function("1M", bench_mainnet_insert::<1_000_000>(mainnet_accounts));
+
+    c.benchmark_group("calculate root keccak256 hash of a mainnet-like account tree")
+        .measurement_time(Duration::from_secs(10))
+        .bench_function("1k", bench_mainnet_hash::<1_000>(mainnet_accounts))
+        .bench_function("10k", bench_mainnet_hash::<10_000>(mainnet_accounts));
+
+    c.benchmark_group("get() from a mainnet-like storage tree")
+        .bench_function("1k", bench_mainnet_get::<1_000>(mainnet_storage))
+        .bench_function("10k", bench_mainnet_get::<10_000>(mainnet_storage))
+        .bench_function("100k", bench_mainnet_get::<100_000>(mainnet_storage));
+
+    c.benchmark_group("insert() into a mainnet-like storage tree")
+        .bench_function("1k", bench_mainnet_insert::<1_000>(mainnet_storage))
+        .bench_function("10k", bench_mainnet_insert::<10_000>(mainnet_storage))
+        .bench_function("100k", bench_mainnet_insert::<100_000>(mainnet_storage));
+
+    c.benchmark_group("calculate root keccak256 hash of a mainnet-like storage tree")
+        .measurement_time(Duration::from_secs(10))
+        .bench_function("1k", bench_mainnet_hash::<1_000>(mainnet_storage))
+        .bench_function("10k", bench_mainnet_hash::<10_000>(mainnet_storage));
+
+    // Set by the geth harness's driver when given -replay.
+    if let Ok(path) = env::var("MPT_REPLAY") {
+        c.benchmark_group("replay a recorded trace")
+            .bench_function("trace", bench_replay(path));
+    }
 }
 
 criterion_group!(benches, criterion_benchmark);
@@ -1,221 +1,505 @@
 use criterion::{black_box, Bencher};
 use digest::Digest;
 use patricia_merkle_tree::PatriciaMerkleTree;
-use rand::{distributions::Uniform, prelude::Distribution, thread_rng, RngCore};
+use rand::{distributions::Uniform, prelude::Distribution, thread_rng, Rng, RngCore};
 use sha3::Keccak256;
 use std::{
     collections::BTreeMap,
     time::{Duration, Instant},
 };
 
+/// Defer a benchmark's setup until criterion first runs it. Criterion only runs the benchmarks
+/// matching its filter, so the trees of the sizes that were not asked for are never built.
+pub fn lazy<F, I>(init: I) -> impl FnMut(&mut Bencher)
+where
+    F: FnMut(&mut Bencher),
+    I: FnOnce() -> F,
+{
+    let mut init = Some(init);
+    let mut bench = None;
+    move |b| bench.get_or_insert_with(|| init.take().unwrap()())(b)
+}
+
 pub fn bench_get<const N: usize>() -> impl FnMut(&mut Bencher) {
-    // Generate a completely random Patricia Merkle tree.
-    let mut tree = PatriciaMerkleTree::<Vec<u8>, &[u8; 32], Keccak256>::new();
-    let mut all_paths = Vec::with_capacity(N);
+    lazy(move || {
+        // Generate a completely random Patricia Merkle tree.
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, &[u8; 32], Keccak256>::new();
+        let mut all_paths = Vec::with_capacity(N);
 
-    let value = &[0; 32];
+        let value = &[0; 32];
 
-    let mut rng = thread_rng();
-    let distr = Uniform::from(16..=64);
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
 
-    while all_paths.len() < N {
-        let path_len = distr.sample(&mut rng) as usize;
+        while all_paths.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
 
-        if tree.insert(path.clone(), value).is_none() {
-            all_paths.push(path);
+            if tree.insert(path.clone(), value).is_none() {
+                all_paths.push(path);
+            }
         }
-    }
 
-    move |b| {
-        let mut path_iter = all_paths.iter().cycle();
-        b.iter(|| tree.get(black_box(path_iter.next().unwrap())));
-    }
+        move |b| {
+            let mut path_iter = all_paths.iter().cycle();
+            b.iter(|| tree.get(black_box(path_iter.next().unwrap())));
+        }
+    })
 }
 
 pub fn bench_insert<const N: usize>() -> impl FnMut(&mut Bencher) {
-    // Generate a completely random Patricia Merkle tree.
-    let mut tree = PatriciaMerkleTree::<Vec<u8>, _, Keccak256>::new();
-    let mut all_paths = Vec::with_capacity(N);
+    lazy(move || {
+        // Generate a completely random Patricia Merkle tree.
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, _, Keccak256>::new();
+        let mut all_paths = Vec::with_capacity(N);
 
-    let value = &[0; 32];
+        let value = &[0; 32];
 
-    let mut rng = thread_rng();
-    let distr = Uniform::from(16..=64);
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
 
-    while all_paths.len() < N {
-        let path_len = distr.sample(&mut rng) as usize;
+        while all_paths.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
 
-        if tree.insert(path.clone(), value).is_none() {
-            all_paths.push(path);
+            if tree.insert(path.clone(), value).is_none() {
+                all_paths.push(path);
+            }
         }
-    }
 
-    // Generate random nodes to insert.
-    let mut new_nodes = Vec::new();
-    while new_nodes.len() < 1000 {
-        let path_len = distr.sample(&mut rng) as usize;
+        // Generate random nodes to insert.
+        let mut new_nodes = Vec::new();
+        while new_nodes.len() < 1000 {
+            let path_len = distr.sample(&mut rng) as usize;
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
 
-        if tree.get(&path).is_none() {
-            new_nodes.push((path, value));
+            if tree.get(&path).is_none() {
+                new_nodes.push((path, value));
+            }
         }
-    }
 
-    move |b| {
-        // This (iter_custom) is required because of a bug in criterion, which will include setup
-        // time in the final calculation (which we don't want).
-        b.iter_custom(|num_iters| {
-            const STEP: usize = 1024;
-
-            let mut delta = Duration::ZERO;
-            for offset in (0..num_iters).step_by(STEP) {
-                let new_nodes = new_nodes.clone();
-                let mut tree = tree.clone();
-
-                let mut path_iter = new_nodes.into_iter().cycle();
-                tree.reserve_next_power_of_two();
-
-                // To make measurements more effective, values are inserted STEP at a time, making
-                // all values except the first one to be inserted with a tree slightly larger than
-                // intended. It should not affect the results significantly.
-                let measure = Instant::now();
-                for _ in offset..num_iters.min(offset + STEP as u64) {
-                    let (path, value) = path_iter.next().unwrap();
-                    tree.insert(black_box(path), black_box(value));
+        move |b| {
+            // This (iter_custom) is required because of a bug in criterion, which will include setup
+            // time in the final calculation (which we don't want).
+            b.iter_custom(|num_iters| {
+                const STEP: usize = 1024;
+
+                let mut delta = Duration::ZERO;
+                for offset in (0..num_iters).step_by(STEP) {
+                    let new_nodes = new_nodes.clone();
+                    let mut tree = tree.clone();
+
+                    let mut path_iter = new_nodes.into_iter().cycle();
+                    tree.reserve_next_power_of_two();
+
+                    // To make measurements more effective, values are inserted STEP at a time, making
+                    // all values except the first one to be inserted with a tree slightly larger than
+                    // intended. It should not affect the results significantly.
+                    let measure = Instant::now();
+                    for _ in offset..num_iters.min(offset + STEP as u64) {
+                        let (path, value) = path_iter.next().unwrap();
+                        tree.insert(black_box(path), black_box(value));
+                    }
+                    delta += measure.elapsed();
                 }
-                delta += measure.elapsed();
+
+                delta
+            });
+        }
+    })
+}
+
+pub fn bench_remove<const N: usize>() -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        // Generate a completely random Patricia Merkle tree.
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, _, Keccak256>::new();
+        let mut all_paths = Vec::with_capacity(N);
+
+        let value = &[0; 32];
+
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
+
+        while all_paths.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
+
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
+
+            if tree.insert(path.clone(), value).is_none() {
+                all_paths.push(path);
             }
+        }
 
-            delta
-        });
-    }
+        move |b| {
+            // See `bench_insert()` for why `iter_custom` is required.
+            b.iter_custom(|num_iters| {
+                // Each copy loses at most half of its paths, so that removals run against a tree
+                // close to its nominal size instead of one shrinking to nothing.
+                let step = (N / 2).min(1024);
+
+                let mut delta = Duration::ZERO;
+                for offset in (0..num_iters).step_by(step) {
+                    let mut tree = tree.clone();
+                    let mut path_iter = all_paths.iter().cloned();
+
+                    let measure = Instant::now();
+                    for _ in offset..num_iters.min(offset + step as u64) {
+                        tree.remove(black_box(path_iter.next().unwrap()));
+                    }
+                    delta += measure.elapsed();
+                }
+
+                delta
+            });
+        }
+    })
 }
 
 pub fn bench_compute_hash<const N: usize, H: Digest + Clone>() -> impl FnMut(&mut Bencher) {
-    let mut tree = PatriciaMerkleTree::<Vec<u8>, Vec<u8>, H>::new();
-    let mut all_paths = Vec::with_capacity(N);
+    lazy(move || {
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, Vec<u8>, H>::new();
+        let mut all_paths = Vec::with_capacity(N);
 
-    let mut rng = thread_rng();
-    let distr = Uniform::from(16..=64);
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
 
-    while all_paths.len() < N {
-        let path_len = distr.sample(&mut rng) as usize;
+        while all_paths.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
 
-        let value_len = distr.sample(&mut rng) as usize;
+            let value_len = distr.sample(&mut rng) as usize;
 
-        let mut value = vec![0; value_len];
-        rng.fill_bytes(&mut value);
+            let mut value = vec![0; value_len];
+            rng.fill_bytes(&mut value);
 
-        if tree.insert(path.clone(), value).is_none() {
-            all_paths.push(path);
+            if tree.insert(path.clone(), value).is_none() {
+                all_paths.push(path);
+            }
         }
-    }
 
-    move |b| {
-        b.iter_custom(|num_iters| {
-            let mut delta = Duration::ZERO;
-            for _ in 0..num_iters {
-                let mut tree = tree.clone();
-                let measure = Instant::now();
-                black_box(tree.compute_hash());
-                delta += measure.elapsed();
-            }
-            delta
-        });
-    }
+        move |b| {
+            b.iter_custom(|num_iters| {
+                let mut delta = Duration::ZERO;
+                for _ in 0..num_iters {
+                    let mut tree = tree.clone();
+                    let measure = Instant::now();
+                    black_box(tree.compute_hash());
+                    delta += measure.elapsed();
+                }
+                delta
+            });
+        }
+    })
 }
 
 pub fn bench_compute_hash_inserts<const N: usize, H: Digest + Clone>() -> impl FnMut(&mut Bencher) {
-    let mut rng = thread_rng();
-    let distr = Uniform::from(16..=64);
-    let mut data = BTreeMap::new();
+    lazy(move || {
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
+        let mut data = BTreeMap::new();
 
-    while data.len() < N {
-        let path_len = distr.sample(&mut rng) as usize;
+        while data.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
 
-        let value_len = distr.sample(&mut rng) as usize;
+            let value_len = distr.sample(&mut rng) as usize;
 
-        let mut value = vec![0; value_len];
-        rng.fill_bytes(&mut value);
+            let mut value = vec![0; value_len];
+            rng.fill_bytes(&mut value);
 
-        data.insert(path, value);
-    }
+            data.insert(path, value);
+        }
 
-    move |b| {
-        let data: Vec<_> = data.clone().into_iter().collect();
-        let data: Vec<_> = data
-            .iter()
-            .map(|x| (x.0.as_slice(), x.1.as_slice()))
-            .collect();
-
-        b.iter_custom(|num_iters| {
-            let mut delta = Duration::ZERO;
-            for _ in 0..num_iters {
-                let iter = data.iter();
-                let measure = Instant::now();
-                let mut tree = PatriciaMerkleTree::<_, _, H>::new();
-                for (key, val) in iter {
-                    tree.insert(black_box(*key), black_box(*val));
+        move |b| {
+            let data: Vec<_> = data.clone().into_iter().collect();
+            let data: Vec<_> = data
+                .iter()
+                .map(|x| (x.0.as_slice(), x.1.as_slice()))
+                .collect();
+
+            b.iter_custom(|num_iters| {
+                let mut delta = Duration::ZERO;
+                for _ in 0..num_iters {
+                    let iter = data.iter();
+                    let measure = Instant::now();
+                    let mut tree = PatriciaMerkleTree::<_, _, H>::new();
+                    for (key, val) in iter {
+                        tree.insert(black_box(*key), black_box(*val));
+                    }
+                    black_box(tree.compute_hash());
+                    delta += measure.elapsed();
                 }
-                black_box(tree.compute_hash());
-                delta += measure.elapsed();
-            }
-            delta
-        });
-    }
+                delta
+            });
+        }
+    })
 }
 
 pub fn bench_compute_hash_sorted<const N: usize, H: Digest + Clone>() -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        let mut rng = thread_rng();
+        let distr = Uniform::from(16..=64);
+        let mut data = BTreeMap::new();
+
+        while data.len() < N {
+            let path_len = distr.sample(&mut rng) as usize;
+
+            let mut path = vec![0; path_len];
+            rng.fill_bytes(&mut path);
+
+            let value_len = distr.sample(&mut rng) as usize;
+
+            let mut value = vec![0; value_len];
+            rng.fill_bytes(&mut value);
+
+            data.insert(path, value);
+        }
+
+        move |b| {
+            let data: Vec<_> = data.clone().into_iter().collect();
+            let data: Vec<_> = data
+                .iter()
+                .map(|x| (x.0.as_slice(), x.1.as_slice()))
+                .collect();
+
+            b.iter_custom(|num_iters| {
+                let mut delta = Duration::ZERO;
+                for _ in 0..num_iters {
+                    let iter = data.iter();
+                    let measure = Instant::now();
+                    black_box(
+                        PatriciaMerkleTree::<_, _, H>::compute_hash_from_sorted_iter(black_box(
+                            iter,
+                        )),
+                    );
+                    delta += measure.elapsed();
+                }
+                delta
+            });
+        }
+    })
+}
+
+// Workloads shaped like mainnet state, mirroring `mainnet_test.go` in the geth harness: 32-byte
+// keccak256 paths, RLP-encoded accounts or storage slots as values, and reads following a zipfian
+// distribution so that a few hot paths account for most accesses.
+
+pub type KvSet = Vec<(Vec<u8>, Vec<u8>)>;
+
+/// Generate `n` accounts keyed by the keccak256 of a random address, as in the account trie.
+/// Roughly one in ten accounts is a contract with its own storage root and code hash.
+pub fn mainnet_accounts(n: usize) -> KvSet {
+    let empty_root = Keccak256::digest([0x80u8]);
+    let empty_code_hash = Keccak256::digest(b"");
+
     let mut rng = thread_rng();
-    let distr = Uniform::from(16..=64);
-    let mut data = BTreeMap::new();
+    (0..n)
+        .map(|_| {
+            let mut address = [0; 20];
+            rng.fill_bytes(&mut address);
+
+            let mut root = empty_root.to_vec();
+            let mut code_hash = empty_code_hash.to_vec();
+            if rng.gen_ratio(1, 10) {
+                rng.fill_bytes(&mut root);
+                rng.fill_bytes(&mut code_hash);
+            }
 
-    while data.len() < N {
-        let path_len = distr.sample(&mut rng) as usize;
+            let mut account = Vec::new();
+            rlp_uint(&mut account, rng.gen_range(0..1000));
+            rlp_uint(&mut account, rng.next_u64());
+            rlp_bytes(&mut account, &root);
+            rlp_bytes(&mut account, &code_hash);
 
-        let mut path = vec![0; path_len];
-        rng.fill_bytes(&mut path);
+            let mut value = Vec::new();
+            rlp_length(&mut value, 0xC0, account.len());
+            value.extend(account);
 
-        let value_len = distr.sample(&mut rng) as usize;
+            (Keccak256::digest(address).to_vec(), value)
+        })
+        .collect()
+}
 
-        let mut value = vec![0; value_len];
-        rng.fill_bytes(&mut value);
+/// Generate `n` storage slots of a single contract. A few slots are plain sequential variables and
+/// the rest are mapping entries located at keccak256(key . slot), as laid out by solidity. Paths
+/// are hashed once more, as in the storage trie, and values are the RLP of the zero-trimmed,
+/// non-zero word.
+pub fn mainnet_storage(n: usize) -> KvSet {
+    let mut rng = thread_rng();
+    (0..n)
+        .map(|i| {
+            let mut slot = [0; 32];
+            let slot = if i < 16 {
+                slot[24..].copy_from_slice(&(i as u64).to_be_bytes());
+                slot.to_vec()
+            } else {
+                let mut key = [0; 32];
+                rng.fill_bytes(&mut key[12..]);
+                slot[24..].copy_from_slice(&rng.gen_range(0..16u64).to_be_bytes());
+                Keccak256::new()
+                    .chain_update(key)
+                    .chain_update(slot)
+                    .finalize()
+                    .to_vec()
+            };
+
+            // Zero words are deleted rather than stored, so make sure the leading byte is set.
+            let mut word = [0; 32];
+            let start = rng.gen_range(0..32usize);
+            rng.fill_bytes(&mut word[start..]);
+            word[start] = rng.gen_range(1..=255);
+
+            let mut value = Vec::new();
+            rlp_bytes(&mut value, &word[start..]);
+
+            (Keccak256::digest(slot).to_vec(), value)
+        })
+        .collect()
+}
 
-        data.insert(path, value);
+fn rlp_length(out: &mut Vec<u8>, offset: u8, len: usize) {
+    if len < 56 {
+        out.push(offset + len as u8);
+    } else {
+        let len = len.to_be_bytes();
+        let len = &len[len.iter().position(|&x| x != 0).unwrap()..];
+        out.push(offset + 55 + len.len() as u8);
+        out.extend_from_slice(len);
     }
+}
 
-    move |b| {
-        let data: Vec<_> = data.clone().into_iter().collect();
-        let data: Vec<_> = data
-            .iter()
-            .map(|x| (x.0.as_slice(), x.1.as_slice()))
-            .collect();
-
-        b.iter_custom(|num_iters| {
-            let mut delta = Duration::ZERO;
-            for _ in 0..num_iters {
-                let iter = data.iter();
-                let measure = Instant::now();
-                black_box(
-                    PatriciaMerkleTree::<_, _, H>::compute_hash_from_sorted_iter(black_box(iter)),
-                );
-                delta += measure.elapsed();
-            }
-            delta
-        });
+fn rlp_bytes(out: &mut Vec<u8>, data: &[u8]) {
+    match data {
+        [x] if *x < 0x80 => out.push(*x),
+        _ => {
+            rlp_length(out, 0x80, data.len());
+            out.extend_from_slice(data);
+        }
     }
 }
+
+fn rlp_uint(out: &mut Vec<u8>, value: u64) {
+    let value = value.to_be_bytes();
+    let start = value.iter().position(|&x| x != 0).unwrap_or(value.len());
+    rlp_bytes(out, &value[start..]);
+}
+
+/// Return `count` indices in `0..n` drawn from a zipfian distribution with the same parameters
+/// as the geth harness (`rand.NewZipf(r, 1.1, 1, n - 1)`).
+fn zipf_order(n: usize, count: usize) -> Vec<usize> {
+    let mut cdf = Vec::with_capacity(n);
+    let mut total = 0.0;
+    for k in 0..n {
+        total += (k as f64 + 1.0).powf(-1.1);
+        cdf.push(total);
+    }
+
+    let mut rng = thread_rng();
+    (0..count)
+        .map(|_| {
+            let x = rng.gen::<f64>() * total;
+            cdf.partition_point(|&c| c <= x).min(n - 1)
+        })
+        .collect()
+}
+
+pub fn bench_mainnet_get<const N: usize>(generate: fn(usize) -> KvSet) -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        let all_nodes = generate(N);
+
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, Vec<u8>, Keccak256>::new();
+        for (path, value) in all_nodes.iter().cloned() {
+            tree.insert(path, value);
+        }
+
+        let order = zipf_order(all_nodes.len(), 1 << 16);
+
+        move |b| {
+            let mut path_iter = order.iter().map(|&i| &all_nodes[i].0).cycle();
+            b.iter(|| tree.get(black_box(path_iter.next().unwrap())));
+        }
+    })
+}
+
+pub fn bench_mainnet_insert<const N: usize>(
+    generate: fn(usize) -> KvSet,
+) -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, Vec<u8>, Keccak256>::new();
+        for (path, value) in generate(N) {
+            tree.insert(path, value);
+        }
+
+        // Generators may emit paths that are already in the tree (such as the sequential storage
+        // slots), which would make for overwrites instead of inserts, so skip those.
+        let mut new_nodes = BTreeMap::new();
+        while new_nodes.len() < 1000 {
+            for (path, value) in generate(1000) {
+                if new_nodes.len() < 1000 && tree.get(&path).is_none() {
+                    new_nodes.insert(path, value);
+                }
+            }
+        }
+        let new_nodes: Vec<_> = new_nodes.into_iter().collect();
+
+        move |b| {
+            // See `bench_insert()` for why `iter_custom` is required.
+            b.iter_custom(|num_iters| {
+                const STEP: usize = 1024;
+
+                let mut delta = Duration::ZERO;
+                for offset in (0..num_iters).step_by(STEP) {
+                    let new_nodes = new_nodes.clone();
+                    let mut tree = tree.clone();
+
+                    let mut path_iter = new_nodes.into_iter().cycle();
+                    tree.reserve_next_power_of_two();
+
+                    let measure = Instant::now();
+                    for _ in offset..num_iters.min(offset + STEP as u64) {
+                        let (path, value) = path_iter.next().unwrap();
+                        tree.insert(black_box(path), black_box(value));
+                    }
+                    delta += measure.elapsed();
+                }
+
+                delta
+            });
+        }
+    })
+}
+
+pub fn bench_mainnet_hash<const N: usize>(
+    generate: fn(usize) -> KvSet,
+) -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        let mut tree = PatriciaMerkleTree::<Vec<u8>, Vec<u8>, Keccak256>::new();
+        for (path, value) in generate(N) {
+            tree.insert(path, value);
+        }
+
+        move |b| {
+            b.iter_custom(|num_iters| {
+                let mut delta = Duration::ZERO;
+                for _ in 0..num_iters {
+                    let mut tree = tree.clone();
+                    let measure = Instant::now();
+                    black_box(tree.compute_hash());
+                    delta += measure.elapsed();
+                }
+                delta
+            });
+        }
+    })
+}
@@ -0,0 +1,114 @@
+//! Replay of the operation traces recorded by the geth harness's `trace` package, so that a
+//! captured workload can be measured on this implementation as well. See
+//! `external-benches/geth/trace/trace.go` for the format.
+
+use crate::common::lazy;
+use criterion::{black_box, Bencher};
+use patricia_merkle_tree::PatriciaMerkleTree;
+use sha3::Keccak256;
+use std::{fs, io, path::Path};
+
+const MAGIC: &[u8] = b"MPTTRACE";
+const VERSION: u8 = 1;
+
+/// A single recorded operation. Keys are the keccak256 of the original keys and updates only keep
+/// the length of their value.
+pub enum Op {
+    Get([u8; 32]),
+    Update([u8; 32], usize),
+    Delete([u8; 32]),
+    Commit,
+}
+
+/// Read every operation of the trace at `path`.
+pub fn read_trace(path: impl AsRef<Path>) -> io::Result<Vec<Op>> {
+    let invalid = |msg: String| io::Error::new(io::ErrorKind::InvalidData, format!("trace: {msg}"));
+    let truncated = || invalid("unexpected end of trace".to_string());
+
+    let contents = fs::read(path)?;
+    let mut data = match contents.strip_prefix(MAGIC) {
+        Some([VERSION, rest @ ..]) => rest,
+        Some([version, ..]) => return Err(invalid(format!("unsupported version {version}"))),
+        _ => return Err(invalid("not a trace file".to_string())),
+    };
+
+    let mut ops = Vec::new();
+    while let Some((&kind, rest)) = data.split_first() {
+        data = rest;
+
+        let op = match kind {
+            1..=3 => {
+                let key: [u8; 32] = data.get(..32).ok_or_else(truncated)?.try_into().unwrap();
+                data = &data[32..];
+
+                match kind {
+                    1 => Op::Get(key),
+                    2 => {
+                        let (len, rest) = read_uvarint(data).ok_or_else(truncated)?;
+                        data = rest;
+                        Op::Update(key, len)
+                    }
+                    _ => Op::Delete(key),
+                }
+            }
+            4 => Op::Commit,
+            _ => return Err(invalid(format!("unknown operation {kind}"))),
+        };
+        ops.push(op);
+    }
+
+    Ok(ops)
+}
+
+fn read_uvarint(data: &[u8]) -> Option<(usize, &[u8])> {
+    let mut value = 0u64;
+    for (i, &byte) in data.iter().enumerate().take(10) {
+        value |= u64::from(byte & 0x7F) << (7 * i);
+        if byte < 0x80 {
+            return Some((value as usize, &data[i + 1..]));
+        }
+    }
+
+    None
+}
+
+/// Apply `ops` to an empty tree, updating paths with all-zero values as the geth harness does.
+fn replay(ops: &[Op], zeros: &[u8]) {
+    let mut tree = PatriciaMerkleTree::<[u8; 32], &[u8], Keccak256>::new();
+    for op in ops {
+        match op {
+            Op::Get(key) => {
+                black_box(tree.get(key));
+            }
+            Op::Update(key, len) => {
+                tree.insert(*key, &zeros[..*len]);
+            }
+            Op::Delete(key) => {
+                tree.remove(*key);
+            }
+            // There is no database to commit nodes to, so a commit amounts to hashing the tree.
+            Op::Commit => {
+                tree.compute_hash();
+            }
+        }
+    }
+
+    black_box(tree.compute_hash());
+}
+
+pub fn bench_replay(path: String) -> impl FnMut(&mut Bencher) {
+    lazy(move || {
+        let ops = read_trace(&path).unwrap_or_else(|err| panic!("{path}: {err}"));
+        let max_len = ops
+            .iter()
+            .map(|op| match op {
+                Op::Update(_, len) => *len,
+                _ => 0,
+            })
+            .max()
+            .unwrap_or(0);
+        let zeros = vec![0; max_len];
+
+        move |b| b.iter(|| replay(black_box(&ops), &zeros))
+    })
+}
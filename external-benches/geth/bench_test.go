@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"math/rand"
+	"runtime"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -9,9 +11,6 @@ import (
 	"golang.org/x/exp/constraints"
 )
 
-func main() {
-}
-
 func BenchmarkGet1k(b *testing.B)   { benchGet(b, 1000) }
 func BenchmarkGet10k(b *testing.B)  { benchGet(b, 10000) }
 func BenchmarkGet100k(b *testing.B) { benchGet(b, 100000) }
@@ -24,6 +23,11 @@ func BenchmarkInsert100k(b *testing.B) { benchInsert(b, 100000) }
 func BenchmarkInsert1m(b *testing.B)   { benchInsert(b, 1000000) }
 func BenchmarkInsert10m(b *testing.B)  { benchInsert(b, 10000000) }
 
+func BenchmarkDelete1k(b *testing.B)   { benchDelete(b, 1000) }
+func BenchmarkDelete10k(b *testing.B)  { benchDelete(b, 10000) }
+func BenchmarkDelete100k(b *testing.B) { benchDelete(b, 100000) }
+func BenchmarkDelete1m(b *testing.B)   { benchDelete(b, 1000000) }
+
 func BenchmarkHash100(b *testing.B) { benchHash(b, 100) }
 func BenchmarkHash500(b *testing.B) { benchHash(b, 500) }
 func BenchmarkHash1k(b *testing.B)  { benchHash(b, 1000) }
@@ -49,6 +53,7 @@ func benchGet(b *testing.B, benchElemCount int) {
 		paths = append(paths, k)
 	}
 
+	mem := startMemStats()
 	b.SetParallelism(1)
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -59,6 +64,37 @@ func benchGet(b *testing.B, benchElemCount int) {
 		j = j % benchElemCount
 	}
 	b.StopTimer()
+	mem.report(b)
+}
+
+var memStats = flag.Bool("memstats", false, "report heap, allocation and GC pause metrics")
+
+// memRecorder samples runtime.MemStats around a benchmark's timed loop when
+// -memstats is given, and does nothing otherwise.
+type memRecorder struct {
+	before runtime.MemStats
+}
+
+func startMemStats() *memRecorder {
+	if !*memStats {
+		return nil
+	}
+	m := new(memRecorder)
+	runtime.ReadMemStats(&m.before)
+	return m
+}
+
+func (m *memRecorder) report(b *testing.B) {
+	if m == nil {
+		return
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	b.ReportMetric(float64(after.HeapInuse), heapInuseMetric)
+	b.ReportMetric(float64(after.TotalAlloc-m.before.TotalAlloc)/float64(b.N), totalAllocMetric)
+	b.ReportMetric(float64(after.PauseTotalNs-m.before.PauseTotalNs)/float64(b.N), gcPauseMetric)
+	b.ReportMetric(float64(after.NumGC-m.before.NumGC)/float64(b.N), gcCyclesMetric)
 }
 
 func min[T constraints.Ordered](a, b T) T {
@@ -102,6 +138,7 @@ func benchInsert(b *testing.B, benchElemCount int) {
 
 	const step = 1024
 
+	mem := startMemStats()
 	b.SetParallelism(1)
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -120,6 +157,51 @@ func benchInsert(b *testing.B, benchElemCount int) {
 		}
 		b.StopTimer()
 	}
+	mem.report(b)
+}
+
+func benchDelete(b *testing.B, benchElemCount int) {
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	t := trie.NewEmpty(triedb)
+
+	paths := make([][]byte, 0, benchElemCount)
+
+	value := make([]byte, 32, 32)
+	for i := 0; i < len(value); i++ {
+		value[i] = 0
+	}
+
+	for i := 0; i < benchElemCount; i++ {
+		path_len := 16 + rand.Intn(48)
+		k := make([]byte, path_len)
+		rand.Read(k)
+		t.Update(k, value)
+		paths = append(paths, k)
+	}
+
+	// Each copy loses at most half of its keys, so that deletes run against a
+	// tree close to its nominal size instead of one shrinking to nothing.
+	step := min(1024, benchElemCount/2)
+
+	mem := startMemStats()
+	b.SetParallelism(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.StopTimer()
+
+	for i := 0; i < b.N; i += step {
+
+		tt := t.Copy()
+
+		b.StartTimer()
+		c := 0
+		for j := i; j < min(b.N, i+step); j++ {
+			tt.Delete(paths[c])
+			c = c + 1
+		}
+		b.StopTimer()
+	}
+	mem.report(b)
 }
 
 func benchHash(b *testing.B, benchElemCount int) {
@@ -140,6 +222,7 @@ func benchHash(b *testing.B, benchElemCount int) {
 		paths = append(paths, k)
 	}
 
+	mem := startMemStats()
 	b.SetParallelism(1)
 	b.ResetTimer()
 	b.StopTimer()
@@ -152,4 +235,5 @@ func benchHash(b *testing.B, benchElemCount int) {
 		b.StopTimer()
 	}
 	//b.StopTimer()
+	mem.report(b)
 }
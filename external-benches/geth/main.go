@@ -0,0 +1,503 @@
+package main
+
+// Running this package (`go run .`) benchmarks the same workloads against
+// lambda's Rust implementation, through `cargo bench`, and against geth's
+// trie, through `go test -bench`, and then prints both side by side. With
+// -format json or csv the results are emitted in a machine readable form
+// instead, and -baseline compares them against a previous JSON report. With
+// -replay a recorded trace (see the trace package) is replayed on both instead
+// of running the workloads.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type workload struct {
+	name  string
+	bench string // Go benchmark function prefix.
+	group string // Criterion benchmark group.
+
+	lambdaSizes []string // Sizes the criterion group defines, lowercased.
+	gethSizes   []string // Sizes bench_test.go defines, lowercased.
+}
+
+func (w workload) lambda() []string { return w.lambdaSizes }
+func (w workload) geth() []string   { return w.gethSizes }
+
+var (
+	treeSizes   = []string{"1k", "10k", "100k", "1m", "10m", "100m"}
+	gethSizes   = []string{"1k", "10k", "100k", "1m", "10m"} // geth times out at 100m.
+	hashSizes   = []string{"100", "500", "1k", "2k", "5k", "10k"}
+	deleteSizes = []string{"1k", "10k", "100k", "1m"}
+
+	// Mainnet-like workloads, see mainnet_test.go.
+	accountSizes     = []string{"1k", "10k", "100k", "1m"}
+	storageSizes     = []string{"1k", "10k", "100k"}
+	mainnetHashSizes = []string{"1k", "10k"}
+)
+
+var workloads = []workload{
+	{"get", "Get", "get() from a tree made with random values", treeSizes, gethSizes},
+	{"insert", "Insert", "insert() from a tree made with random values", treeSizes, gethSizes},
+	{"hash", "Hash", "calculate root keccak256 hash with random items", hashSizes, hashSizes},
+	{"delete", "Delete", "remove() from a tree made with random values", deleteSizes, deleteSizes},
+	{"account-get", "AccountGet", "get() from a mainnet-like account tree", accountSizes, accountSizes},
+	{"account-insert", "AccountInsert", "insert() into a mainnet-like account tree", accountSizes, accountSizes},
+	{"account-hash", "AccountHash", "calculate root keccak256 hash of a mainnet-like account tree", mainnetHashSizes, mainnetHashSizes},
+	{"storage-get", "StorageGet", "get() from a mainnet-like storage tree", storageSizes, storageSizes},
+	{"storage-insert", "StorageInsert", "insert() into a mainnet-like storage tree", storageSizes, storageSizes},
+	{"storage-hash", "StorageHash", "calculate root keccak256 hash of a mainnet-like storage tree", mainnetHashSizes, mainnetHashSizes},
+}
+
+// replayWorkload replays the whole trace given with -replay from an empty
+// tree on every iteration. Its only size is "trace".
+var replayWorkload = workload{"replay", "Replay", "replay a recorded trace", []string{"trace"}, []string{"trace"}}
+
+type result struct {
+	nsPerOp     float64
+	bytesPerOp  float64
+	allocsPerOp float64
+	memory      map[string]float64 // Only set with -memstats, see memstats.go.
+}
+
+func unknownResult() result {
+	return result{math.NaN(), math.NaN(), math.NaN(), nil}
+}
+
+func main() {
+	workloadList := flag.String("workloads", "get,insert,hash,delete", "comma separated list of workloads to run")
+	sizeList := flag.String("sizes", "1k,10k", "comma separated list of tree sizes to run")
+	implList := flag.String("impls", "lambda,geth", "comma separated list of implementations to run")
+	benchtime := flag.String("benchtime", "", "forwarded to go test as -benchtime")
+	memstats := flag.Bool("memstats", false, "also measure heap usage, allocations and GC pauses of geth")
+	crate := flag.String("crate", "../..", "path to the Rust crate")
+	format := flag.String("format", "table", "output format: table, json or csv")
+	baseline := flag.String("baseline", "", "JSON report to compare against; exits nonzero on regressions")
+	threshold := flag.Float64("threshold", 0.1, "fraction by which a metric may exceed the baseline")
+	replay := flag.String("replay", "", "trace file to replay on every implementation instead of running the workloads")
+	flag.Parse()
+
+	selected, err := selectWorkloads(*workloadList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sizes := strings.Split(strings.ToLower(*sizeList), ",")
+
+	if *replay != "" {
+		// Both harnesses run from another directory.
+		if *replay, err = filepath.Abs(*replay); err != nil {
+			log.Fatal(err)
+		}
+		selected, sizes = []workload{replayWorkload}, replayWorkload.lambdaSizes
+	}
+
+	impls := strings.Split(*implList, ",")
+	definedSizes := map[string]func(workload) []string{"lambda": workload.lambda, "geth": workload.geth}
+	for _, impl := range impls {
+		defined, ok := definedSizes[impl]
+		if !ok {
+			log.Fatalf("unknown implementation %q", impl)
+		}
+		if err := checkSizes(impl, selected, sizes, defined); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results := make(map[string]map[string]result)
+	for _, impl := range impls {
+		switch impl {
+		case "geth":
+			results[impl], err = runGeth(selected, sizes, *benchtime, *memstats, *replay)
+		case "lambda":
+			results[impl], err = runLambda(selected, sizes, *crate, *replay)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rep := newReport(*crate, selected, sizes, results)
+	switch *format {
+	case "table":
+		printTable(os.Stdout, selected, sizes, results["lambda"], results["geth"])
+	case "json":
+		err = writeJSON(os.Stdout, rep)
+	case "csv":
+		err = writeCSV(os.Stdout, rep)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *baseline != "" {
+		ok, err := checkBaseline(*baseline, rep, *threshold)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	}
+}
+
+func selectWorkloads(list string) ([]workload, error) {
+	var selected []workload
+	for _, name := range strings.Split(list, ",") {
+		found := false
+		for _, w := range workloads {
+			if w.name == name {
+				selected = append(selected, w)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown workload %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func alternation(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = regexp.QuoteMeta(item)
+	}
+	return "(" + strings.Join(quoted, "|") + ")"
+}
+
+// runGeth runs the benchmarks from bench_test.go and returns their results
+// keyed by "workload/size". A non-empty replay is the trace BenchmarkReplayTrace
+// replays.
+func runGeth(selected []workload, sizes []string, benchtime string, memstats bool, replay string) (map[string]result, error) {
+	names := make([]string, len(selected))
+	for i, w := range selected {
+		names[i] = w.bench
+	}
+
+	args := []string{"test", "-run", "^$", "-benchmem",
+		"-bench", "(?i)^Benchmark" + alternation(names) + alternation(sizes) + "$"}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), "GOMAXPROCS=1")
+	cmd.Stdout = io.MultiWriter(&out, os.Stderr)
+	cmd.Stderr = os.Stderr
+	if memstats {
+		// go test forwards the test binary's stderr, where the runtime writes
+		// its gctrace, to stdout, so it stays in order with the results.
+		cmd.Args = append(cmd.Args, "-memstats")
+		cmd.Env = append(cmd.Env, "GODEBUG=gctrace=1")
+	}
+	if replay != "" {
+		cmd.Args = append(cmd.Args, "-replay", replay)
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go test: %w", err)
+	}
+
+	results, err := parseGoBench(&out, selected)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResults("go test", results, selected, sizes, workload.geth); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// parseGoBench parses the standard `go test -bench` output format, along
+// with any gctrace lines interleaved with it.
+func parseGoBench(r io.Reader, selected []workload) (map[string]result, error) {
+	results := make(map[string]result)
+
+	// A benchmark's name is printed before it starts running, and its
+	// measurements once it is done, so gctrace lines may show up in between.
+	var current string
+	var gcPause float64
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], "Benchmark") {
+			name := procsSuffix.ReplaceAllString(strings.TrimPrefix(fields[0], "Benchmark"), "")
+			if name != current {
+				current, gcPause = name, 0
+			}
+			line = strings.TrimPrefix(strings.TrimSpace(line), fields[0])
+		}
+
+		if pause, ok := parseGCTrace(line); ok {
+			gcPause += pause
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if current == "" || len(fields) < 3 || len(fields)%2 == 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			continue
+		}
+
+		for _, w := range selected {
+			if !strings.HasPrefix(current, w.bench) {
+				continue
+			}
+
+			res := unknownResult()
+			for i := 1; i+1 < len(fields); i += 2 {
+				value, err := strconv.ParseFloat(fields[i], 64)
+				if err != nil {
+					return nil, fmt.Errorf("parsing %q: %w", scanner.Text(), err)
+				}
+				switch unit := fields[i+1]; unit {
+				case "ns/op":
+					res.nsPerOp = value
+				case "B/op":
+					res.bytesPerOp = value
+				case "allocs/op":
+					res.allocsPerOp = value
+				default:
+					// Other custom metrics, such as BenchmarkReplayTrace's
+					// ns/traced-op, have no lambda counterpart to compare to.
+					for _, name := range memMetrics {
+						if unit != name {
+							continue
+						}
+						if res.memory == nil {
+							res.memory = make(map[string]float64)
+						}
+						res.memory[unit] = value
+					}
+				}
+			}
+			if res.memory != nil {
+				res.memory[gctracePauseMetric] = gcPause
+			}
+			results[w.name+"/"+strings.ToLower(strings.TrimPrefix(current, w.bench))] = res
+		}
+		current = ""
+	}
+
+	return results, scanner.Err()
+}
+
+// runLambda runs the criterion benchmarks from benches/bench.rs and returns
+// their results keyed by "workload/size". Criterion does not measure
+// allocations, so only nsPerOp is filled in. A non-empty replay is the trace
+// the "replay a recorded trace" group replays.
+func runLambda(selected []workload, sizes []string, crate string, replay string) (map[string]result, error) {
+	groups := make([]string, len(selected))
+	for i, w := range selected {
+		groups[i] = w.group
+	}
+
+	cmd := exec.Command("cargo", "bench", "--bench", "bench", "--",
+		"(?i)^"+alternation(groups)+"/"+alternation(sizes)+"$")
+	cmd.Dir = crate
+	if replay != "" {
+		cmd.Env = append(os.Environ(), "MPT_REPLAY="+replay)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// File modification times come from a coarser clock than time.Now, so
+	// allow some slack when telling this run's results from older ones.
+	start := time.Now().Add(-time.Second)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cargo bench: %w", err)
+	}
+
+	return readCriterion(filepath.Join(crate, "target", "criterion"), selected, sizes, start)
+}
+
+// readCriterion collects the estimates criterion saved since the given time
+// for the selected workloads and sizes. Results left over from earlier runs,
+// or for benchmarks that were not asked for, are ignored, and a requested
+// benchmark without a fresh result is an error.
+func readCriterion(dir string, selected []workload, sizes []string, since time.Time) (map[string]result, error) {
+	expected := make(map[string]string)
+	for _, w := range selected {
+		for _, size := range sizes {
+			for _, defined := range w.lambdaSizes {
+				if size == defined {
+					expected[w.group+"/"+size] = w.name + "/" + size
+				}
+			}
+		}
+	}
+
+	results := make(map[string]result)
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*", "new", "benchmark.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		var id struct {
+			GroupID    string `json:"group_id"`
+			FunctionID string `json:"function_id"`
+		}
+		if err := readJSON(path, &id); err != nil {
+			return nil, err
+		}
+
+		key, ok := expected[id.GroupID+"/"+strings.ToLower(id.FunctionID)]
+		if !ok {
+			continue
+		}
+
+		estimatesPath := filepath.Join(filepath.Dir(path), "estimates.json")
+		if info, err := os.Stat(estimatesPath); err != nil || info.ModTime().Before(since) {
+			continue
+		}
+
+		var estimates struct {
+			Mean struct {
+				PointEstimate float64 `json:"point_estimate"`
+			} `json:"mean"`
+		}
+		if err := readJSON(estimatesPath, &estimates); err != nil {
+			return nil, err
+		}
+
+		res := unknownResult()
+		res.nsPerOp = estimates.Mean.PointEstimate
+		results[key] = res
+	}
+
+	if err := checkResults("cargo bench", results, selected, sizes, workload.lambda); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkSizes fails when a requested size is not defined, as listed by
+// defined, by any of the selected workloads, which would otherwise make for
+// a run without any results for it.
+func checkSizes(impl string, selected []workload, sizes []string, defined func(workload) []string) error {
+	for _, size := range sizes {
+		found := false
+		for _, w := range selected {
+			for _, d := range defined(w) {
+				found = found || d == size
+			}
+		}
+		if !found {
+			return fmt.Errorf("no selected workload defines size %q for %s", size, impl)
+		}
+	}
+	return nil
+}
+
+// checkResults fails when results lacks any requested size that a selected
+// workload defines, naming the tool that should have produced it.
+func checkResults(tool string, results map[string]result, selected []workload, sizes []string, defined func(workload) []string) error {
+	var missing []string
+	for _, w := range selected {
+		for _, size := range sizes {
+			for _, d := range defined(w) {
+				if _, ok := results[w.name+"/"+size]; d == size && !ok {
+					missing = append(missing, w.name+"/"+size)
+				}
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s produced no results for %s", tool, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func printTable(w io.Writer, selected []workload, sizes []string, lambda, geth map[string]result) {
+	memory := false
+	for _, g := range geth {
+		memory = memory || g.memory != nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "workload\tsize\tlambda ns/op\tgeth ns/op\tgeth B/op\tgeth allocs/op\tlambda/geth\t")
+	if memory {
+		for _, name := range memMetrics {
+			fmt.Fprintf(tw, "geth %s\t", name)
+		}
+	}
+	fmt.Fprintln(tw)
+
+	for _, wl := range selected {
+		for _, size := range sizes {
+			key := wl.name + "/" + size
+			l, lok := lambda[key]
+			g, gok := geth[key]
+			if !lok && !gok {
+				continue
+			}
+			if !lok {
+				l = unknownResult()
+			}
+			if !gok {
+				g = unknownResult()
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t", wl.name, size,
+				formatValue(l.nsPerOp, 2), formatValue(g.nsPerOp, 2),
+				formatValue(g.bytesPerOp, 0), formatValue(g.allocsPerOp, 0),
+				formatValue(l.nsPerOp/g.nsPerOp, 3))
+			if memory {
+				for _, name := range memMetrics {
+					v, ok := g.memory[name]
+					if !ok {
+						v = math.NaN()
+					}
+					fmt.Fprintf(tw, "%s\t", formatValue(v, 0))
+				}
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+
+	tw.Flush()
+}
+
+func formatValue(v float64, prec int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
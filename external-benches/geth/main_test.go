@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGoBench(t *testing.T) {
+	output := `goos: linux
+goarch: amd64
+pkg: lambdaclass.com/geth-bench
+BenchmarkGet1k-8     	 5000000	       180.0 ns/op	     111 B/op	       2 allocs/op
+BenchmarkHash100 	gc 1 @0.005s 3%: 0.015+0.32+0.005 ms clock, 0.015+0.10/0.21/0+0.002 ms cpu, 4->4->1 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 1 P
+gc 2 @0.010s 3%: 0.010+0.40+0.010 ms clock, 0.010+0.10/0.21/0+0.002 ms cpu, 4->4->1 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 1 P
+    2000	    237478 ns/op	         1.500 gc-cycles/op	   3448832 heap-inuse-B	   52013 B/op	     747 allocs/op
+BenchmarkAccountGet1k 	    2000	       626.6 ns/op	     104 B/op	       2 allocs/op
+PASS
+ok  	lambdaclass.com/geth-bench	0.511s
+`
+
+	results, err := parseGoBench(strings.NewReader(output), workloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3: %v", len(results), results)
+	}
+
+	get := results["get/1k"]
+	if get.nsPerOp != 180 || get.bytesPerOp != 111 || get.allocsPerOp != 2 || get.memory != nil {
+		t.Errorf("get/1k: got %+v", get)
+	}
+
+	// AccountGet must not be taken for a get benchmark.
+	accountGet := results["account-get/1k"]
+	if accountGet.nsPerOp != 626.6 || accountGet.bytesPerOp != 104 || accountGet.allocsPerOp != 2 {
+		t.Errorf("account-get/1k: got %+v", accountGet)
+	}
+
+	hash := results["hash/100"]
+	if hash.nsPerOp != 237478 || hash.bytesPerOp != 52013 || hash.allocsPerOp != 747 {
+		t.Errorf("hash/100: got %+v", hash)
+	}
+	wantMemory := map[string]float64{
+		gcCyclesMetric:     1.5,
+		heapInuseMetric:    3448832,
+		gctracePauseMetric: (0.015 + 0.005 + 0.010 + 0.010) * 1e6,
+	}
+	for name, want := range wantMemory {
+		if got := hash.memory[name]; math.Abs(got-want) > 1e-6 {
+			t.Errorf("hash/100 %s: got %g, want %g", name, got, want)
+		}
+	}
+}
+
+func TestParseGoBenchReplay(t *testing.T) {
+	output := `BenchmarkReplayTrace 	    1000	      6254 ns/op	      1563 ns/traced-op	    2712 B/op	      40 allocs/op
+`
+
+	results, err := parseGoBench(strings.NewReader(output), []workload{replayWorkload})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ns/traced-op has no lambda counterpart, so it is not kept.
+	replay, ok := results["replay/trace"]
+	if !ok || replay.nsPerOp != 6254 || replay.bytesPerOp != 2712 || replay.allocsPerOp != 40 || replay.memory != nil {
+		t.Fatalf("got %+v", results)
+	}
+}
+
+func writeCriterionResult(t *testing.T, dir, group, function string, ns float64, modTime time.Time) {
+	path := filepath.Join(dir, strings.ReplaceAll(group, "()", "__"), function, "new")
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"benchmark.json": fmt.Sprintf(`{"group_id":%q,"function_id":%q}`, group, function),
+		"estimates.json": fmt.Sprintf(`{"mean":{"point_estimate":%g}}`, ns),
+	}
+	for name, content := range files {
+		file := filepath.Join(path, name)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCriterion(t *testing.T) {
+	get, hash := workloads[0], workloads[2]
+	since := time.Now()
+	stale, fresh := since.Add(-time.Hour), since.Add(time.Second)
+
+	t.Run("fresh results only", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCriterionResult(t, dir, get.group, "1k", 10, fresh)
+		writeCriterionResult(t, dir, get.group, "1M", 20, fresh)
+		writeCriterionResult(t, dir, get.group, "10k", 30, stale) // Not requested.
+		writeCriterionResult(t, dir, hash.group, "1k", 40, fresh) // Not requested.
+
+		results, err := readCriterion(dir, []workload{get}, []string{"1k", "1m"}, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results["get/1k"].nsPerOp != 10 || results["get/1m"].nsPerOp != 20 {
+			t.Fatalf("got %+v", results)
+		}
+	})
+
+	t.Run("stale result", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCriterionResult(t, dir, get.group, "1k", 10, stale)
+
+		if _, err := readCriterion(dir, []workload{get}, []string{"1k"}, since); err == nil {
+			t.Fatal("expected an error for a stale result")
+		}
+	})
+
+	t.Run("missing result", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCriterionResult(t, dir, get.group, "1k", 10, fresh)
+
+		_, err := readCriterion(dir, []workload{get, hash}, []string{"1k"}, since)
+		if err == nil || !strings.Contains(err.Error(), "hash/1k") {
+			t.Fatalf("got error %v, want one naming hash/1k", err)
+		}
+	})
+
+	t.Run("size not defined by the group", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCriterionResult(t, dir, hash.group, "100", 10, fresh)
+
+		// Criterion has no 100 entry for get, so it is not expected.
+		results, err := readCriterion(dir, []workload{get, hash}, []string{"100"}, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results["hash/100"].nsPerOp != 10 {
+			t.Fatalf("got %+v", results)
+		}
+	})
+}
+
+func TestCheckSizes(t *testing.T) {
+	get, hash := workloads[0], workloads[2]
+
+	if err := checkSizes("geth", []workload{get, hash}, []string{"100", "1m"}, workload.geth); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSizes("geth", []workload{get}, []string{"100"}, workload.geth); err == nil {
+		t.Fatal("expected an error for a size get does not define")
+	}
+	if err := checkSizes("geth", []workload{get}, []string{"100m"}, workload.geth); err == nil {
+		t.Fatal("expected an error for a size only criterion defines")
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	get, hash := workloads[0], workloads[2]
+	results := map[string]result{"get/1k": unknownResult()}
+
+	if err := checkResults("go test", results, []workload{get, hash}, []string{"1k", "100k"}, workload.geth); err == nil ||
+		!strings.Contains(err.Error(), "get/100k, hash/1k") {
+		t.Fatalf("got error %v, want one naming get/100k and hash/1k", err)
+	}
+	if err := checkResults("go test", results, []workload{get, hash}, []string{"1k", "100"}, workload.geth); err == nil ||
+		strings.Contains(err.Error(), "get/100") {
+		t.Fatalf("got error %v, want one not naming get/100", err)
+	}
+}
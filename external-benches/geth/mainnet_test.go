@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Workloads shaped like mainnet state: 32-byte keccak256 keys, RLP-encoded
+// accounts or storage slots as values, and reads following a zipfian
+// distribution so that a few hot keys account for most accesses.
+
+func BenchmarkAccountGet1k(b *testing.B)   { benchZipfGet(b, mainnetAccounts(1000)) }
+func BenchmarkAccountGet10k(b *testing.B)  { benchZipfGet(b, mainnetAccounts(10000)) }
+func BenchmarkAccountGet100k(b *testing.B) { benchZipfGet(b, mainnetAccounts(100000)) }
+func BenchmarkAccountGet1m(b *testing.B)   { benchZipfGet(b, mainnetAccounts(1000000)) }
+
+func BenchmarkAccountInsert1k(b *testing.B)   { benchMainnetInsert(b, mainnetAccounts, 1000) }
+func BenchmarkAccountInsert10k(b *testing.B)  { benchMainnetInsert(b, mainnetAccounts, 10000) }
+func BenchmarkAccountInsert100k(b *testing.B) { benchMainnetInsert(b, mainnetAccounts, 100000) }
+func BenchmarkAccountInsert1m(b *testing.B)   { benchMainnetInsert(b, mainnetAccounts, 1000000) }
+
+func BenchmarkAccountHash1k(b *testing.B)  { benchMainnetHash(b, mainnetAccounts(1000)) }
+func BenchmarkAccountHash10k(b *testing.B) { benchMainnetHash(b, mainnetAccounts(10000)) }
+
+func BenchmarkStorageGet1k(b *testing.B)   { benchZipfGet(b, mainnetStorage(1000)) }
+func BenchmarkStorageGet10k(b *testing.B)  { benchZipfGet(b, mainnetStorage(10000)) }
+func BenchmarkStorageGet100k(b *testing.B) { benchZipfGet(b, mainnetStorage(100000)) }
+
+func BenchmarkStorageInsert1k(b *testing.B)   { benchMainnetInsert(b, mainnetStorage, 1000) }
+func BenchmarkStorageInsert10k(b *testing.B)  { benchMainnetInsert(b, mainnetStorage, 10000) }
+func BenchmarkStorageInsert100k(b *testing.B) { benchMainnetInsert(b, mainnetStorage, 100000) }
+
+func BenchmarkStorageHash1k(b *testing.B)  { benchMainnetHash(b, mainnetStorage(1000)) }
+func BenchmarkStorageHash10k(b *testing.B) { benchMainnetHash(b, mainnetStorage(10000)) }
+
+type kvSet struct {
+	keys   [][]byte
+	values [][]byte
+}
+
+var emptyCodeHash = crypto.Keccak256(nil)
+
+// mainnetAccounts generates n accounts keyed by the keccak256 of a random
+// address, as in the account trie. Roughly one in ten accounts is a contract
+// with its own storage root and code hash.
+func mainnetAccounts(n int) kvSet {
+	set := kvSet{make([][]byte, 0, n), make([][]byte, 0, n)}
+
+	for i := 0; i < n; i++ {
+		address := make([]byte, common.AddressLength)
+		rand.Read(address)
+
+		account := types.StateAccount{
+			Nonce:    uint64(rand.Intn(1000)),
+			Balance:  new(big.Int).SetUint64(rand.Uint64()),
+			Root:     types.EmptyRootHash,
+			CodeHash: emptyCodeHash,
+		}
+		if rand.Intn(10) == 0 {
+			rand.Read(account.Root[:])
+			account.CodeHash = make([]byte, common.HashLength)
+			rand.Read(account.CodeHash)
+		}
+
+		value, err := rlp.EncodeToBytes(&account)
+		if err != nil {
+			panic(err)
+		}
+
+		set.keys = append(set.keys, crypto.Keccak256(address))
+		set.values = append(set.values, value)
+	}
+
+	return set
+}
+
+// mainnetStorage generates n storage slots of a single contract. A few slots
+// are plain sequential variables and the rest are mapping entries located at
+// keccak256(key . slot), as laid out by solidity. Keys are hashed once more,
+// as in the storage trie, and values are the RLP of the zero-trimmed, non-zero
+// word.
+func mainnetStorage(n int) kvSet {
+	set := kvSet{make([][]byte, 0, n), make([][]byte, 0, n)}
+
+	for i := 0; i < n; i++ {
+		slot := make([]byte, common.HashLength)
+		if i < 16 {
+			binary.BigEndian.PutUint64(slot[common.HashLength-8:], uint64(i))
+		} else {
+			key := make([]byte, common.HashLength)
+			rand.Read(key[common.HashLength-common.AddressLength:])
+			binary.BigEndian.PutUint64(slot[common.HashLength-8:], uint64(rand.Intn(16)))
+			slot = crypto.Keccak256(key, slot)
+		}
+
+		// Zero words are deleted rather than stored, so make sure the leading
+		// byte is set.
+		word := make([]byte, common.HashLength)
+		start := rand.Intn(common.HashLength)
+		rand.Read(word[start:])
+		word[start] = byte(1 + rand.Intn(255))
+
+		value, err := rlp.EncodeToBytes(common.TrimLeftZeroes(word))
+		if err != nil {
+			panic(err)
+		}
+
+		set.keys = append(set.keys, crypto.Keccak256(slot))
+		set.values = append(set.values, value)
+	}
+
+	return set
+}
+
+func (set kvSet) build() *trie.Trie {
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	t := trie.NewEmpty(triedb)
+
+	for i := range set.keys {
+		t.Update(set.keys[i], set.values[i])
+	}
+
+	return t
+}
+
+// zipfOrder returns count indices in [0, n) drawn from a zipfian distribution.
+func zipfOrder(n, count int) []int {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(rand.Int63())), 1.1, 1, uint64(n-1))
+
+	order := make([]int, count)
+	for i := range order {
+		order[i] = int(zipf.Uint64())
+	}
+
+	return order
+}
+
+func benchZipfGet(b *testing.B, set kvSet) {
+	t := set.build()
+	order := zipfOrder(len(set.keys), 1<<16)
+
+	mem := startMemStats()
+	b.SetParallelism(1)
+	b.ResetTimer()
+	b.ReportAllocs()
+	j := 0
+	for i := 0; i < b.N; i++ {
+		t.Get(set.keys[order[j]])
+		j = j + 1
+		j = j % len(order)
+	}
+	b.StopTimer()
+	mem.report(b)
+}
+
+func benchMainnetInsert(b *testing.B, generate func(n int) kvSet, benchElemCount int) {
+	set := generate(benchElemCount)
+	t := set.build()
+
+	// Generators may emit keys that are already in the trie (such as the
+	// sequential storage slots), which would make for overwrites instead of
+	// inserts, so skip those.
+	existing := make(map[string]bool, len(set.keys))
+	for _, k := range set.keys {
+		existing[string(k)] = true
+	}
+
+	var new_set kvSet
+	for len(new_set.keys) < 1000 {
+		candidates := generate(1000)
+		for i, k := range candidates.keys {
+			if existing[string(k)] || len(new_set.keys) == 1000 {
+				continue
+			}
+			existing[string(k)] = true
+			new_set.keys = append(new_set.keys, k)
+			new_set.values = append(new_set.values, candidates.values[i])
+		}
+	}
+
+	const step = 1024
+
+	mem := startMemStats()
+	b.SetParallelism(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.StopTimer()
+
+	for i := 0; i < b.N; i += step {
+
+		tt := t.Copy()
+
+		b.StartTimer()
+		c := 0
+		for j := i; j < min(b.N, i+step); j++ {
+			tt.Update(new_set.keys[c], new_set.values[c])
+			c = c + 1
+			c = c % len(new_set.keys)
+		}
+		b.StopTimer()
+	}
+	mem.report(b)
+}
+
+func benchMainnetHash(b *testing.B, set kvSet) {
+	t := set.build()
+
+	mem := startMemStats()
+	b.SetParallelism(1)
+	b.ResetTimer()
+	b.StopTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		tt := t.Copy()
+		b.StartTimer()
+		tt.Hash()
+		b.StopTimer()
+	}
+	mem.report(b)
+}
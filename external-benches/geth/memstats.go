@@ -0,0 +1,63 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Metrics reported by the benchmarks when run with -memstats. Heap in use is
+// sampled once the workload finishes so it includes the trie being
+// benchmarked; the others are differences over the benchmark loop divided by
+// b.N, including any untimed per-iteration setup such as copying the trie.
+const (
+	heapInuseMetric  = "heap-inuse-B"
+	totalAllocMetric = "total-alloc-B/op"
+	gcPauseMetric    = "gc-pause-ns/op"
+	gcCyclesMetric   = "gc-cycles/op"
+
+	// gctracePauseMetric is computed by the driver from GODEBUG=gctrace=1
+	// output. It covers every run of a benchmark function, setup included, so
+	// it depends on how many b.N values go test tried and is not gated on.
+	gctracePauseMetric = "gctrace-pause-ns"
+)
+
+var memMetrics = []string{
+	heapInuseMetric,
+	totalAllocMetric,
+	gcPauseMetric,
+	gcCyclesMetric,
+	gctracePauseMetric,
+}
+
+// gatedMemMetrics are the memMetrics that are comparable between runs and
+// therefore checked by -baseline.
+var gatedMemMetrics = []string{
+	heapInuseMetric,
+	totalAllocMetric,
+	gcPauseMetric,
+	gcCyclesMetric,
+}
+
+// gctraceLine matches the wall clock part of a gctrace line, e.g.
+// "gc 4 @0.018s 2%: 0.010+0.52+0.003 ms clock, ...". The first and last
+// phases are the stop-the-world pauses.
+var gctraceLine = regexp.MustCompile(`gc \d+ @[0-9.]+s \d+%: ([0-9.]+)\+[0-9.]+\+([0-9.]+) ms clock`)
+
+// parseGCTrace returns the stop-the-world pause in nanoseconds described by
+// a gctrace line, and whether the line was one.
+func parseGCTrace(line string) (float64, bool) {
+	m := gctraceLine.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+
+	var pause float64
+	for _, ms := range m[1:] {
+		v, err := strconv.ParseFloat(ms, 64)
+		if err != nil {
+			return 0, false
+		}
+		pause += v * 1e6
+	}
+	return pause, true
+}
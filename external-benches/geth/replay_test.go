@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"lambdaclass.com/geth-bench/trace"
+)
+
+var replay = flag.String("replay", "", "trace file for BenchmarkReplayTrace to reproduce")
+
+// BenchmarkReplayTrace replays the whole trace given with -replay against an
+// empty trie once per iteration. Commits are written to an in-memory
+// database and the trie is reopened at the new root, as a client would.
+func BenchmarkReplayTrace(b *testing.B) {
+	if *replay == "" {
+		b.Skip("no trace given with -replay")
+	}
+
+	ops, err := loadTrace(*replay)
+	if err != nil {
+		b.Fatal(err)
+	}
+	values := replayValues(ops)
+
+	mem := startMemStats()
+	b.SetParallelism(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := replayOps(ops, values); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*len(ops)), "ns/traced-op")
+	mem.report(b)
+}
+
+// TestReplay records a short session through trace.Recorder and checks that
+// replaying it yields the trie the session would have built from the hashed
+// keys and zeroed values a trace keeps.
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := trace.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	rec := trace.NewRecorder(trie.NewEmpty(triedb), w)
+	want := trie.NewEmpty(trie.NewDatabase(rawdb.NewMemoryDatabase()))
+
+	update := func(key, value string) {
+		if err := rec.TryUpdate([]byte(key), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+		want.Update(crypto.Keccak256([]byte(key)), make([]byte, len(value)))
+	}
+	update("do", "verb")
+	update("dog", "puppy")
+	update("doge", "coin")
+	if _, err := rec.TryGet([]byte("dog")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, nodes, err := rec.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := triedb.Update(trie.NewWithNodeSet(nodes)); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := trie.New(common.Hash{}, root, triedb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Reopen(reopened)
+
+	update("horse", "stallion")
+	if err := rec.TryDelete([]byte("doge")); err != nil {
+		t.Fatal(err)
+	}
+	want.Delete(crypto.Keccak256([]byte("doge")))
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := loadTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 7 {
+		t.Fatalf("got %d traced operations, want 7", len(ops))
+	}
+
+	got, err := replayOps(ops, replayValues(ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want.Hash() {
+		t.Fatalf("replayed root %x, want %x", got, want.Hash())
+	}
+}
+
+func loadTrace(path string) ([]trace.Op, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := trace.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("empty trace")
+	}
+	return ops, nil
+}
+
+// replayValues allocates the all-zero value of every length updates use.
+func replayValues(ops []trace.Op) map[uint64][]byte {
+	values := make(map[uint64][]byte)
+	for _, op := range ops {
+		if _, ok := values[op.ValueLen]; op.Kind == trace.Update && !ok {
+			values[op.ValueLen] = make([]byte, op.ValueLen)
+		}
+	}
+	return values
+}
+
+// replayOps applies ops to an empty trie and returns its final root hash.
+func replayOps(ops []trace.Op, values map[uint64][]byte) (common.Hash, error) {
+	triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	t := trie.NewEmpty(triedb)
+
+	var err error
+	for _, op := range ops {
+		switch op.Kind {
+		case trace.Get:
+			_, err = t.TryGet(op.Key[:])
+		case trace.Update:
+			err = t.TryUpdate(op.Key[:], values[op.ValueLen])
+		case trace.Delete:
+			err = t.TryDelete(op.Key[:])
+		case trace.Commit:
+			t, err = replayCommit(t, triedb)
+		}
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("replaying %v: %w", op.Kind, err)
+		}
+	}
+
+	return t.Hash(), nil
+}
+
+func replayCommit(t *trie.Trie, triedb *trie.Database) (*trie.Trie, error) {
+	root, nodes, err := t.Commit(false)
+	if err != nil {
+		return nil, err
+	}
+	if nodes != nil {
+		if err := triedb.Update(trie.NewWithNodeSet(nodes)); err != nil {
+			return nil, err
+		}
+	}
+	return trie.New(common.Hash{}, root, triedb)
+}
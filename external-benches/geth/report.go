@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// report is the machine readable form of a driver run. Its JSON encoding is
+// also the format expected by -baseline.
+type report struct {
+	Commit    string    `json:"commit"`
+	Date      time.Time `json:"date"`
+	GoVersion string    `json:"go_version"`
+	Results   []record  `json:"results"`
+}
+
+// record holds the measurements of one implementation for one workload and
+// tree size. Metrics the implementation's harness does not measure are nil.
+type record struct {
+	Impl        string   `json:"impl"`
+	Workload    string   `json:"workload"`
+	Size        string   `json:"size"`
+	NsPerOp     *float64 `json:"ns_per_op,omitempty"`
+	BytesPerOp  *float64 `json:"bytes_per_op,omitempty"`
+	AllocsPerOp *float64 `json:"allocs_per_op,omitempty"`
+
+	Memory map[string]float64 `json:"memory,omitempty"`
+}
+
+func (r record) key() string {
+	return r.Impl + "/" + r.Workload + "/" + r.Size
+}
+
+func (r record) metrics() map[string]*float64 {
+	metrics := map[string]*float64{
+		"ns/op":     r.NsPerOp,
+		"B/op":      r.BytesPerOp,
+		"allocs/op": r.AllocsPerOp,
+	}
+	for _, name := range memMetrics {
+		if v, ok := r.Memory[name]; ok {
+			metrics[name] = &v
+		}
+	}
+	return metrics
+}
+
+func optional(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+func newReport(crate string, selected []workload, sizes []string, results map[string]map[string]result) report {
+	rep := report{
+		Commit:    gitCommit(crate),
+		Date:      time.Now().UTC(),
+		GoVersion: runtime.Version(),
+	}
+
+	for _, impl := range []string{"lambda", "geth"} {
+		for _, w := range selected {
+			for _, size := range sizes {
+				res, ok := results[impl][w.name+"/"+size]
+				if !ok {
+					continue
+				}
+				rep.Results = append(rep.Results, record{
+					Impl:        impl,
+					Workload:    w.name,
+					Size:        size,
+					NsPerOp:     optional(res.nsPerOp),
+					BytesPerOp:  optional(res.bytesPerOp),
+					AllocsPerOp: optional(res.allocsPerOp),
+					Memory:      res.memory,
+				})
+			}
+		}
+	}
+
+	return rep
+}
+
+// gitCommit returns the commit checked out in dir, or an empty string when it
+// cannot be determined.
+func gitCommit(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeJSON(w io.Writer, rep report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+var csvColumn = strings.NewReplacer("-", "_", "/", "_per_")
+
+func writeCSV(w io.Writer, rep report) error {
+	formatOptional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+
+	header := []string{"commit", "date", "impl", "workload", "size", "ns_per_op", "bytes_per_op", "allocs_per_op"}
+	for _, name := range memMetrics {
+		header = append(header, csvColumn.Replace(name))
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, r := range rep.Results {
+		row := []string{
+			rep.Commit, rep.Date.Format(time.RFC3339), r.Impl, r.Workload, r.Size,
+			formatOptional(r.NsPerOp), formatOptional(r.BytesPerOp), formatOptional(r.AllocsPerOp),
+		}
+		metrics := r.metrics()
+		for _, name := range memMetrics {
+			row = append(row, formatOptional(metrics[name]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readReport(path string) (report, error) {
+	var rep report
+	err := readJSON(path, &rep)
+	return rep, err
+}
+
+// regressions lists every metric of current that is worse than the same
+// metric in baseline by more than threshold (a fraction, 0.1 being 10%), and
+// every baseline result or metric that current lacks. A metric going up from
+// a zero baseline always counts as a regression. Metrics the baseline lacks
+// are not compared.
+func regressions(baseline, current report, threshold float64) []string {
+	cur := make(map[string]record, len(current.Results))
+	for _, r := range current.Results {
+		cur[r.key()] = r
+	}
+
+	var found []string
+	for _, b := range baseline.Results {
+		r, ok := cur[b.key()]
+		if !ok {
+			found = append(found, fmt.Sprintf("%s: missing from this run", b.key()))
+			continue
+		}
+
+		baseMetrics, curMetrics := b.metrics(), r.metrics()
+		for _, name := range append([]string{"ns/op", "B/op", "allocs/op"}, gatedMemMetrics...) {
+			old, cur := baseMetrics[name], curMetrics[name]
+			if old == nil {
+				continue
+			}
+			if cur == nil {
+				found = append(found, fmt.Sprintf("%s %s: missing from this run", r.key(), name))
+				continue
+			}
+			if *old == 0 {
+				if *cur > 0 {
+					found = append(found, fmt.Sprintf("%s %s: 0 -> %g", r.key(), name, *cur))
+				}
+				continue
+			}
+			if *cur > *old*(1+threshold) {
+				found = append(found, fmt.Sprintf("%s %s: %g -> %g (+%.1f%%)",
+					r.key(), name, *old, *cur, (*cur / *old - 1)*100))
+			}
+		}
+	}
+
+	return found
+}
+
+// checkBaseline compares current against the report stored at path, prints
+// any regressions and reports whether there were none.
+func checkBaseline(path string, current report, threshold float64) (bool, error) {
+	baseline, err := readReport(path)
+	if err != nil {
+		return false, err
+	}
+
+	found := regressions(baseline, current, threshold)
+	if len(found) == 0 {
+		fmt.Fprintf(os.Stderr, "no regressions above %.1f%% versus %s\n", threshold*100, path)
+		return true, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%d regressions above %.1f%% versus %s:\n", len(found), threshold*100, path)
+	for _, line := range found {
+		fmt.Fprintln(os.Stderr, "  "+line)
+	}
+	return false, nil
+}
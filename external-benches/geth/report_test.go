@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestRegressions(t *testing.T) {
+	base := func(ns, allocs *float64) record {
+		return record{Impl: "geth", Workload: "get", Size: "1k", NsPerOp: ns, AllocsPerOp: allocs}
+	}
+
+	tests := []struct {
+		name     string
+		baseline []record
+		current  []record
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			baseline: []record{base(float(100), float(2))},
+			current:  []record{base(float(100), float(2))},
+		},
+		{
+			name:     "improvement",
+			baseline: []record{base(float(100), float(2))},
+			current:  []record{base(float(50), float(1))},
+		},
+		{
+			name:     "exactly at threshold",
+			baseline: []record{base(float(100), nil)},
+			current:  []record{base(float(110), nil)},
+		},
+		{
+			name:     "just above threshold",
+			baseline: []record{base(float(100), nil)},
+			current:  []record{base(float(110.5), nil)},
+			want:     []string{"geth/get/1k ns/op: 100 -> 110.5 (+10.5%)"},
+		},
+		{
+			name:     "nil metric in baseline",
+			baseline: []record{base(nil, float(2))},
+			current:  []record{base(float(1000), float(2))},
+		},
+		{
+			name:     "nil metric in current",
+			baseline: []record{base(float(100), float(2))},
+			current:  []record{base(nil, float(2))},
+			want:     []string{"geth/get/1k ns/op: missing from this run"},
+		},
+		{
+			name:     "up from zero baseline",
+			baseline: []record{base(float(100), float(0))},
+			current:  []record{base(float(100), float(1))},
+			want:     []string{"geth/get/1k allocs/op: 0 -> 1"},
+		},
+		{
+			name:     "zero stays zero",
+			baseline: []record{base(float(100), float(0))},
+			current:  []record{base(float(100), float(0))},
+		},
+		{
+			name:     "missing from current run",
+			baseline: []record{base(float(100), nil), {Impl: "lambda", Workload: "get", Size: "1k", NsPerOp: float(10)}},
+			current:  []record{base(float(100), nil)},
+			want:     []string{"lambda/get/1k: missing from this run"},
+		},
+		{
+			name:     "new in current run",
+			baseline: []record{base(float(100), nil)},
+			current:  []record{base(float(100), nil), {Impl: "lambda", Workload: "get", Size: "1k", NsPerOp: float(10)}},
+		},
+		{
+			name:     "memory metric missing from current run",
+			baseline: []record{{Impl: "geth", Workload: "get", Size: "1k", Memory: map[string]float64{totalAllocMetric: 100}}},
+			current:  []record{{Impl: "geth", Workload: "get", Size: "1k"}},
+			want:     []string{"geth/get/1k total-alloc-B/op: missing from this run"},
+		},
+		{
+			name:     "gated memory metric",
+			baseline: []record{{Impl: "geth", Workload: "get", Size: "1k", Memory: map[string]float64{totalAllocMetric: 100}}},
+			current:  []record{{Impl: "geth", Workload: "get", Size: "1k", Memory: map[string]float64{totalAllocMetric: 200}}},
+			want:     []string{"geth/get/1k total-alloc-B/op: 100 -> 200 (+100.0%)"},
+		},
+		{
+			name:     "gctrace is not gated",
+			baseline: []record{{Impl: "geth", Workload: "get", Size: "1k", Memory: map[string]float64{gctracePauseMetric: 100}}},
+			current:  []record{{Impl: "geth", Workload: "get", Size: "1k", Memory: map[string]float64{gctracePauseMetric: 900}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := regressions(report{Results: test.baseline}, report{Results: test.current}, 0.1)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rep := report{
+		Commit: "abc",
+		Date:   time.Date(2023, 2, 16, 0, 0, 0, 0, time.UTC),
+		Results: []record{
+			{Impl: "lambda", Workload: "hash", Size: "1k", NsPerOp: float(1.5)},
+			{Impl: "geth", Workload: "hash", Size: "1k", NsPerOp: float(2), BytesPerOp: float(300), AllocsPerOp: float(4),
+				Memory: map[string]float64{heapInuseMetric: 1024, gctracePauseMetric: 7}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"commit", "date", "impl", "workload", "size", "ns_per_op", "bytes_per_op", "allocs_per_op",
+			"heap_inuse_B", "total_alloc_B_per_op", "gc_pause_ns_per_op", "gc_cycles_per_op", "gctrace_pause_ns"},
+		{"abc", "2023-02-16T00:00:00Z", "lambda", "hash", "1k", "1.5", "", "", "", "", "", "", ""},
+		{"abc", "2023-02-16T00:00:00Z", "geth", "hash", "1k", "2", "300", "4", "1024", "", "", "", "7"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d: got %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Trie is the subset of geth's *trie.Trie that a Recorder wraps.
+type Trie interface {
+	TryGet(key []byte) ([]byte, error)
+	TryUpdate(key, value []byte) error
+	TryDelete(key []byte) error
+	Commit(collectLeaf bool) (common.Hash, *trie.NodeSet, error)
+}
+
+// Recorder forwards operations to a trie, recording each one to a Writer
+// before it is applied.
+type Recorder struct {
+	t Trie
+	w *Writer
+}
+
+// NewRecorder returns a Recorder applying operations to t and recording them
+// to w.
+func NewRecorder(t Trie, w *Writer) *Recorder {
+	return &Recorder{t: t, w: w}
+}
+
+// Reopen makes the Recorder forward to t from now on. geth's tries cannot be
+// used after a commit, so this is how the trie reopened at the committed root
+// is handed back to the Recorder.
+func (r *Recorder) Reopen(t Trie) {
+	r.t = t
+}
+
+// TryGet records a get of key and looks it up in the wrapped trie.
+func (r *Recorder) TryGet(key []byte) ([]byte, error) {
+	if err := r.w.Get(key); err != nil {
+		return nil, err
+	}
+	return r.t.TryGet(key)
+}
+
+// TryUpdate records an update of key and applies it to the wrapped trie.
+func (r *Recorder) TryUpdate(key, value []byte) error {
+	if err := r.w.Update(key, value); err != nil {
+		return err
+	}
+	return r.t.TryUpdate(key, value)
+}
+
+// TryDelete records a delete of key and applies it to the wrapped trie.
+func (r *Recorder) TryDelete(key []byte) error {
+	if err := r.w.Delete(key); err != nil {
+		return err
+	}
+	return r.t.TryDelete(key)
+}
+
+// Commit records a commit and commits the wrapped trie.
+func (r *Recorder) Commit(collectLeaf bool) (common.Hash, *trie.NodeSet, error) {
+	if err := r.w.Commit(); err != nil {
+		return common.Hash{}, nil, err
+	}
+	return r.t.Commit(collectLeaf)
+}
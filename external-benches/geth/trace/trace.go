@@ -0,0 +1,208 @@
+// Package trace records and reads back sequences of trie operations, so that
+// a production workload can be captured once and replayed by the benchmark
+// harness with `go test -bench Replay -replay trace.bin`. Wrapping a trie in a
+// Recorder captures its operations; Writer can also be used directly.
+//
+// A trace file starts with the 8 byte magic "MPTTRACE" followed by a format
+// version byte (currently 1). Each operation then follows as:
+//
+//	op byte       1 = get, 2 = update, 3 = delete, 4 = commit
+//	key [32]byte  keccak256 of the original key (get, update and delete only)
+//	len uvarint   length of the original value (update only)
+//
+// Neither keys nor values are stored: keys are replaced by their hash and
+// values by their length, which are replayed as all-zero values. Replay starts
+// from an empty trie, so gets and deletes of keys that predate the recording
+// replay as misses.
+//
+// This package is part of the benchmark harness's module, which cannot be
+// fetched with go get; see the repository's README for how to depend on it.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Version is the format version written by Writer and accepted by Reader.
+const Version = 1
+
+var magic = []byte("MPTTRACE")
+
+// Kind identifies the operation an Op records.
+type Kind byte
+
+// The operations a trace can record.
+const (
+	Get Kind = iota + 1
+	Update
+	Delete
+	Commit
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Get:
+		return "get"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	case Commit:
+		return "commit"
+	default:
+		return fmt.Sprintf("Kind(%d)", byte(k))
+	}
+}
+
+// Op is a single recorded operation. Key is unset for commits and ValueLen
+// is only set for updates.
+type Op struct {
+	Kind     Kind
+	Key      common.Hash
+	ValueLen uint64
+}
+
+// Writer appends operations to a trace. It buffers its output, so Flush must
+// be called once recording is done.
+type Writer struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes the trace header to w and returns a Writer for it.
+func NewWriter(w io.Writer) (*Writer, error) {
+	tw := &Writer{w: bufio.NewWriter(w)}
+	if _, err := tw.w.Write(magic); err != nil {
+		return nil, err
+	}
+	if err := tw.w.WriteByte(Version); err != nil {
+		return nil, err
+	}
+	return tw, nil
+}
+
+// Get records a lookup of key.
+func (tw *Writer) Get(key []byte) error {
+	return tw.write(Get, key)
+}
+
+// Update records key being set to value. Only the length of value is kept.
+func (tw *Writer) Update(key, value []byte) error {
+	if err := tw.write(Update, key); err != nil {
+		return err
+	}
+	n := binary.PutUvarint(tw.buf[:], uint64(len(value)))
+	_, err := tw.w.Write(tw.buf[:n])
+	return err
+}
+
+// Delete records the removal of key.
+func (tw *Writer) Delete(key []byte) error {
+	return tw.write(Delete, key)
+}
+
+// Commit records a commit of the trie.
+func (tw *Writer) Commit() error {
+	return tw.w.WriteByte(byte(Commit))
+}
+
+// Flush writes any buffered operations to the underlying writer.
+func (tw *Writer) Flush() error {
+	return tw.w.Flush()
+}
+
+func (tw *Writer) write(kind Kind, key []byte) error {
+	if err := tw.w.WriteByte(byte(kind)); err != nil {
+		return err
+	}
+	_, err := tw.w.Write(crypto.Keccak256(key))
+	return err
+}
+
+// Reader reads operations back from a trace.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// ErrBadHeader is returned by NewReader when its input does not start with
+// the trace magic.
+var ErrBadHeader = errors.New("trace: not a trace file")
+
+// NewReader checks the trace header of r and returns a Reader for it.
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := &Reader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(tr.r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadHeader
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(magic)], magic) {
+		return nil, ErrBadHeader
+	}
+	if header[len(magic)] != Version {
+		return nil, fmt.Errorf("trace: unsupported version %d", header[len(magic)])
+	}
+
+	return tr, nil
+}
+
+// Next returns the next operation, or io.EOF once the trace is exhausted.
+func (tr *Reader) Next() (Op, error) {
+	kind, err := tr.r.ReadByte()
+	if err != nil {
+		return Op{}, err
+	}
+
+	op := Op{Kind: Kind(kind)}
+	switch op.Kind {
+	case Get, Update, Delete:
+		if _, err := io.ReadFull(tr.r, op.Key[:]); err != nil {
+			return Op{}, unexpectedEOF(err)
+		}
+	case Commit:
+		return op, nil
+	default:
+		return Op{}, fmt.Errorf("trace: unknown operation %d", kind)
+	}
+
+	if op.Kind == Update {
+		if op.ValueLen, err = binary.ReadUvarint(tr.r); err != nil {
+			return Op{}, unexpectedEOF(err)
+		}
+	}
+
+	return op, nil
+}
+
+// ReadAll reads every remaining operation.
+func (tr *Reader) ReadAll() ([]Op, error) {
+	var ops []Op
+	for {
+		op, err := tr.Next()
+		if err == io.EOF {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
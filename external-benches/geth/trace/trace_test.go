@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func encode(t *testing.T, record func(w *Writer)) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := encode(t, func(w *Writer) {
+		w.Get([]byte("dog"))
+		w.Update([]byte("dog"), []byte("puppy"))
+		w.Update([]byte("horse"), make([]byte, 300))
+		w.Delete([]byte("dog"))
+		w.Commit()
+	})
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dog := common.BytesToHash(crypto.Keccak256([]byte("dog")))
+	horse := common.BytesToHash(crypto.Keccak256([]byte("horse")))
+	want := []Op{
+		{Kind: Get, Key: dog},
+		{Kind: Update, Key: dog, ValueLen: 5},
+		{Kind: Update, Key: horse, ValueLen: 300},
+		{Kind: Delete, Key: dog},
+		{Kind: Commit},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("got %d operations, want %d", len(ops), len(want))
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("op %d: got %+v, want %+v", i, ops[i], want[i])
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	header := len(magic) + 1
+
+	tests := []struct {
+		name   string
+		record func(w *Writer)
+		cut    int
+	}{
+		// Cut in the middle of the 32 byte key.
+		{"key", func(w *Writer) { w.Get([]byte("dog")) }, header + 1 + 16},
+		// A 300 byte value length takes two uvarint bytes; drop the last one.
+		{"uvarint", func(w *Writer) { w.Update([]byte("dog"), make([]byte, 300)) }, header + 1 + 32 + 1},
+		// Drop the whole uvarint.
+		{"missing uvarint", func(w *Writer) { w.Update([]byte("dog"), nil) }, header + 1 + 32},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := encode(t, test.record)
+			r, err := NewReader(bytes.NewReader(data[:test.cut]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+				t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
+
+func TestBadHeader(t *testing.T) {
+	data := encode(t, func(w *Writer) { w.Commit() })
+
+	for name, input := range map[string][]byte{
+		"empty":     nil,
+		"short":     data[:4],
+		"bad magic": append([]byte("NOTTRACE"), data[len(magic):]...),
+	} {
+		if _, err := NewReader(bytes.NewReader(input)); err != ErrBadHeader {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrBadHeader)
+		}
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	data := encode(t, func(w *Writer) { w.Commit() })
+	data[len(magic)] = Version + 1
+
+	_, err := NewReader(bytes.NewReader(data))
+	if err == nil || err == ErrBadHeader || !strings.Contains(err.Error(), "unsupported version") {
+		t.Fatalf("got error %v, want an unsupported version error", err)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestHeaderReadError(t *testing.T) {
+	want := errors.New("disk on fire")
+	if _, err := NewReader(failingReader{want}); err != want {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+func TestUnknownOperation(t *testing.T) {
+	data := append(encode(t, func(*Writer) {}), 0xff)
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err == nil {
+		t.Fatal("expected an error for an unknown operation")
+	}
+}